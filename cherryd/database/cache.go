@@ -0,0 +1,150 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// lookupCacheTTL is how long a memoized MAC/Location answer is
+	// trusted before it's treated as a miss again.
+	lookupCacheTTL = 5 * time.Second
+	// lookupCacheCapacity bounds memory use; the least recently used
+	// entry is evicted once a cache grows past it.
+	lookupCacheCapacity = 4096
+)
+
+// CacheStats is the hit/miss counters of the read-through MAC/Location
+// caches, returned as part of MySQL.Stats().
+type CacheStats struct {
+	MACHits        uint64
+	MACMisses      uint64
+	LocationHits   uint64
+	LocationMisses uint64
+}
+
+type ttlLRUEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// ttlLRU is a small fixed-capacity, TTL-bounded LRU. It memoizes recent
+// MAC/Location answers so a switch flooding PacketIns doesn't force a SQL
+// round-trip for every packet, while still forgetting stale answers once
+// topology discovery moves a host.
+type ttlLRU struct {
+	ttl      time.Duration
+	capacity int
+
+	mu     sync.Mutex
+	items  map[string]*list.Element
+	order  *list.List
+	hits   uint64
+	misses uint64
+}
+
+func newTTLLRU(ttl time.Duration, capacity int) *ttlLRU {
+	return &ttlLRU{
+		ttl:      ttl,
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *ttlLRU) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := el.Value.(*ttlLRUEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits++
+
+	return entry.value, true
+}
+
+func (c *ttlLRU) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*ttlLRUEntry)
+		entry.value = value
+		entry.expiresAt = time.Now().Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&ttlLRUEntry{
+		key:       key,
+		value:     value,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.items[key] = el
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*ttlLRUEntry).key)
+	}
+}
+
+// invalidate evicts key, e.g. because topology discovery just learned the
+// host behind it moved.
+func (c *ttlLRU) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return
+	}
+	c.order.Remove(el)
+	delete(c.items, key)
+}
+
+func (c *ttlLRU) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits, c.misses
+}
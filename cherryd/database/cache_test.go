@@ -0,0 +1,99 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLLRUGetSet(t *testing.T) {
+	c := newTTLLRU(time.Minute, 10)
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+
+	c.set("a", 1)
+	v, ok := c.get("a")
+	if !ok || v.(int) != 1 {
+		t.Fatalf("get(a) = %v, %v; want 1, true", v, ok)
+	}
+}
+
+func TestTTLLRUExpiry(t *testing.T) {
+	c := newTTLLRU(10*time.Millisecond, 10)
+
+	c.set("a", 1)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected entry to have expired")
+	}
+}
+
+func TestTTLLRUCapacityEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTTLLRU(time.Minute, 2)
+
+	c.set("a", 1)
+	c.set("b", 2)
+	// Touch a so b becomes the least recently used entry.
+	c.get("a")
+	c.set("c", 3)
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("expected b to have been evicted as the least recently used entry")
+	}
+	if v, ok := c.get("a"); !ok || v.(int) != 1 {
+		t.Fatalf("expected a to still be cached, got %v, %v", v, ok)
+	}
+	if v, ok := c.get("c"); !ok || v.(int) != 3 {
+		t.Fatalf("expected c to still be cached, got %v, %v", v, ok)
+	}
+}
+
+func TestTTLLRUInvalidate(t *testing.T) {
+	c := newTTLLRU(time.Minute, 10)
+
+	c.set("a", 1)
+	c.invalidate("a")
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected a to have been invalidated")
+	}
+
+	// Invalidating a key that was never set must be a no-op, not a panic.
+	c.invalidate("missing")
+}
+
+func TestTTLLRUStats(t *testing.T) {
+	c := newTTLLRU(time.Minute, 10)
+
+	c.set("a", 1)
+	c.get("a")       // hit
+	c.get("missing") // miss
+
+	hits, misses := c.stats()
+	if hits != 1 || misses != 1 {
+		t.Fatalf("stats() = %d hits, %d misses; want 1, 1", hits, misses)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/dlintw/goconf"
+)
+
+// Backend is the query surface the controller needs from a storage engine.
+// Each supported database engine (MySQL, PostgreSQL, SQLite, ...) provides
+// its own implementation and is selected at runtime via the "driver" key
+// in the config file.
+//
+// MAC and Location take a context so callers such as OpenFlow PacketIn
+// handlers can cancel a slow lookup when the switch that asked for it
+// disconnects in the meantime.
+type Backend interface {
+	// MAC returns the MAC address currently bound to ip. ok is false if
+	// the address is unknown.
+	MAC(ctx context.Context, ip net.IP) (mac net.HardwareAddr, ok bool, err error)
+	// Location returns the switch (dpid) and port number that mac was
+	// last seen on. ok is false if the address is unknown.
+	Location(ctx context.Context, mac net.HardwareAddr) (dpid string, port uint32, ok bool, err error)
+	// Close releases all resources held by the backend.
+	Close() error
+}
+
+// New creates a Backend selected by the "driver" key in the "database"
+// section of the config file. It defaults to "mysql" when the key is
+// missing, so existing config files keep working unmodified.
+func New(conf *goconf.ConfigFile) (Backend, error) {
+	driver, err := conf.GetString("database", "driver")
+	if err != nil || len(driver) == 0 {
+		driver = "mysql"
+	}
+
+	switch driver {
+	case "mysql":
+		return NewMySQL(conf)
+	case "postgres":
+		return NewPostgres(conf)
+	case "sqlite":
+		return NewSQLite(conf)
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %v", driver)
+	}
+}
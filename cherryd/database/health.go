@@ -0,0 +1,221 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// healthCheckInterval is how often the background health-checker
+	// pings every backend host.
+	healthCheckInterval = 10 * time.Second
+	// maxConsecutiveFailures is how many consecutive failures (ping or
+	// query-time connection errors) demote a host to standby.
+	maxConsecutiveFailures = 3
+	// promoteCooldown is how long a demoted host has to stay healthy
+	// before the tracker trusts it as a candidate for the active slot
+	// again.
+	promoteCooldown = 30 * time.Second
+)
+
+// Stats bundles the failover health of every host with the read-through
+// cache's hit/miss counters, as returned by MySQL.Stats().
+type Stats struct {
+	Hosts []HostStats
+	Cache CacheStats
+}
+
+// HostStats is a snapshot of one backend host's observed health, returned
+// as part of MySQL.Stats() so operators can see failover state from the
+// outside.
+type HostStats struct {
+	Host      string
+	Healthy   bool
+	Successes uint64
+	Failures  uint64
+	Latency   time.Duration
+	LastError error
+}
+
+// healthTracker watches a fixed set of hosts, pings them on an interval and
+// keeps them ordered so the healthiest host is always tried first. A host
+// is demoted to standby after maxConsecutiveFailures consecutive failures
+// and is only promoted back to the front once it has stayed healthy for
+// promoteCooldown.
+type healthTracker struct {
+	ping func(host string) error
+
+	mu    sync.Mutex
+	hosts []*hostHealth
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type hostHealth struct {
+	host string
+
+	demoted      bool
+	consecutive  int
+	healthySince time.Time
+
+	successes uint64
+	failures  uint64
+	latency   time.Duration
+	lastErr   error
+}
+
+// newHealthTracker creates a tracker for hosts, all initially assumed
+// healthy, and starts its background ping loop. Call close() to shut it
+// down.
+func newHealthTracker(hosts []string, ping func(host string) error) *healthTracker {
+	t := &healthTracker{
+		ping: ping,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	now := time.Now()
+	for _, h := range hosts {
+		t.hosts = append(t.hosts, &hostHealth{host: h, healthySince: now})
+	}
+
+	go t.run()
+
+	return t
+}
+
+func (t *healthTracker) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.checkAll()
+		}
+	}
+}
+
+func (t *healthTracker) checkAll() {
+	t.mu.Lock()
+	hosts := make([]string, len(t.hosts))
+	for i, h := range t.hosts {
+		hosts[i] = h.host
+	}
+	t.mu.Unlock()
+
+	for _, host := range hosts {
+		start := time.Now()
+		err := t.ping(host)
+		t.record(host, err, time.Since(start))
+	}
+}
+
+// record reports the outcome of a ping or a live query against host so the
+// tracker can demote or promote it. A nil err counts as success even if it
+// came from a query whose rows turned out empty; callers should only pass
+// a non-nil err when the connection itself is at fault.
+func (t *healthTracker) record(host string, err error, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var h *hostHealth
+	for _, candidate := range t.hosts {
+		if candidate.host == host {
+			h = candidate
+			break
+		}
+	}
+	if h == nil {
+		return
+	}
+
+	h.latency = latency
+	if err != nil {
+		h.failures++
+		h.lastErr = err
+		h.consecutive++
+		if h.consecutive >= maxConsecutiveFailures {
+			h.demoted = true
+		}
+		return
+	}
+
+	h.successes++
+	h.lastErr = nil
+	if h.consecutive > 0 {
+		h.healthySince = time.Now()
+	}
+	h.consecutive = 0
+}
+
+// order returns the hosts to try, healthy ones first in their configured
+// order, followed by demoted ones. A demoted host that has stayed healthy
+// for promoteCooldown is promoted back before the list is built.
+func (t *healthTracker) order() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var active, standby []string
+	for _, h := range t.hosts {
+		if h.demoted && h.consecutive == 0 && time.Since(h.healthySince) >= promoteCooldown {
+			h.demoted = false
+		}
+		if h.demoted {
+			standby = append(standby, h.host)
+		} else {
+			active = append(active, h.host)
+		}
+	}
+
+	return append(active, standby...)
+}
+
+func (t *healthTracker) stats() []HostStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]HostStats, 0, len(t.hosts))
+	for _, h := range t.hosts {
+		out = append(out, HostStats{
+			Host:      h.host,
+			Healthy:   !h.demoted,
+			Successes: h.successes,
+			Failures:  h.failures,
+			Latency:   h.latency,
+			LastError: h.lastErr,
+		})
+	}
+
+	return out
+}
+
+func (t *healthTracker) close() {
+	close(t.stop)
+	<-t.done
+}
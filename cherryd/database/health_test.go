@@ -0,0 +1,134 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthTrackerOrderDefaultsToConfigOrder(t *testing.T) {
+	tr := newHealthTracker([]string{"a", "b", "c"}, func(string) error { return nil })
+	defer tr.close()
+
+	got := tr.order()
+	want := []string{"a", "b", "c"}
+	for i, host := range want {
+		if got[i] != host {
+			t.Fatalf("order() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHealthTrackerDemotesAfterConsecutiveFailures(t *testing.T) {
+	tr := newHealthTracker([]string{"a", "b"}, func(string) error { return nil })
+	defer tr.close()
+
+	for i := 0; i < maxConsecutiveFailures-1; i++ {
+		tr.record("a", errors.New("connection refused"), time.Millisecond)
+	}
+	if order := tr.order(); order[0] != "a" {
+		t.Fatalf("host should not be demoted before maxConsecutiveFailures is reached, got order %v", order)
+	}
+
+	tr.record("a", errors.New("connection refused"), time.Millisecond)
+	order := tr.order()
+	if order[0] != "b" || order[1] != "a" {
+		t.Fatalf("expected b first and a demoted to standby, got %v", order)
+	}
+}
+
+func TestHealthTrackerSuccessResetsConsecutiveFailures(t *testing.T) {
+	tr := newHealthTracker([]string{"a"}, func(string) error { return nil })
+	defer tr.close()
+
+	for i := 0; i < maxConsecutiveFailures-1; i++ {
+		tr.record("a", errors.New("connection refused"), time.Millisecond)
+	}
+	tr.record("a", nil, time.Millisecond)
+
+	tr.mu.Lock()
+	consecutive := tr.hosts[0].consecutive
+	tr.mu.Unlock()
+	if consecutive != 0 {
+		t.Fatalf("a success should reset the consecutive failure count, got %d", consecutive)
+	}
+}
+
+func TestHealthTrackerNoPromotionWhileStillFailing(t *testing.T) {
+	tr := newHealthTracker([]string{"a", "b"}, func(string) error { return nil })
+	defer tr.close()
+
+	tr.mu.Lock()
+	tr.hosts[0].demoted = true
+	tr.hosts[0].consecutive = 1
+	tr.hosts[0].healthySince = time.Now().Add(-promoteCooldown - time.Second)
+	tr.mu.Unlock()
+
+	order := tr.order()
+	if order[0] != "b" || order[1] != "a" {
+		t.Fatalf("a is still failing and must not be promoted, got order %v", order)
+	}
+}
+
+func TestHealthTrackerPromotesAfterCooldown(t *testing.T) {
+	tr := newHealthTracker([]string{"a", "b"}, func(string) error { return nil })
+	defer tr.close()
+
+	tr.mu.Lock()
+	tr.hosts[0].demoted = true
+	tr.hosts[0].consecutive = 0
+	tr.hosts[0].healthySince = time.Now().Add(-promoteCooldown - time.Second)
+	tr.mu.Unlock()
+
+	order := tr.order()
+	if order[0] != "a" {
+		t.Fatalf("a has been healthy past the cooldown and should be promoted back first, got order %v", order)
+	}
+
+	tr.mu.Lock()
+	demoted := tr.hosts[0].demoted
+	tr.mu.Unlock()
+	if demoted {
+		t.Fatal("order() should have cleared the demoted flag once the cooldown elapsed")
+	}
+}
+
+func TestHealthTrackerStats(t *testing.T) {
+	tr := newHealthTracker([]string{"a"}, func(string) error { return nil })
+	defer tr.close()
+
+	tr.record("a", nil, 5*time.Millisecond)
+	tr.record("a", errors.New("connection refused"), time.Millisecond)
+
+	stats := tr.stats()
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(stats))
+	}
+	if stats[0].Successes != 1 || stats[0].Failures != 1 {
+		t.Fatalf("expected 1 success and 1 failure, got %+v", stats[0])
+	}
+	if stats[0].LastError == nil {
+		t.Fatal("expected the last failure's error to be recorded")
+	}
+}
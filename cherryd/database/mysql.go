@@ -22,13 +22,20 @@
 package database
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"errors"
 	"fmt"
-	"github.com/dlintw/goconf"
-	"github.com/go-sql-driver/mysql"
+	"io/ioutil"
 	"net"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/dlintw/goconf"
+	"github.com/go-sql-driver/mysql"
 )
 
 const (
@@ -37,7 +44,25 @@ const (
 )
 
 type MySQL struct {
-	db []*sql.DB
+	// hostDB maps each connected host to its connection pool. query()
+	// asks health for the order to try hosts in and looks up the pool
+	// for each one here.
+	hostDB map[string]*sql.DB
+	health *healthTracker
+
+	// stmts caches *sql.Stmt per host+query so MAC/Location don't
+	// re-parse and re-plan their SQL on every PacketIn. Entries are
+	// evicted and re-prepared after a connection error on that host.
+	stmts sync.Map
+
+	// macCache and locationCache memoize recent MAC()/Location() answers.
+	macCache      *ttlLRU // ip.String() -> net.HardwareAddr
+	locationCache *ttlLRU // mac.String() -> mysqlLocation
+}
+
+type mysqlLocation struct {
+	dpid string
+	port uint32
 }
 
 type config struct {
@@ -46,6 +71,22 @@ type config struct {
 	username string
 	password string
 	dbName   string
+
+	// TLS. tlsMode is one of "off", "skip-verify", "preferred" or
+	// "required", following the vocabulary go-sql-driver/mysql itself
+	// uses for its built-in "true"/"skip-verify" settings.
+	tlsMode       string
+	tlsCAFile     string
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsServerName string
+
+	// Optional connection tuning. Zero means "let the driver decide".
+	parseTime       bool
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	collation       string
+	connMaxLifetime time.Duration
 }
 
 func parseConfig(conf *goconf.ConfigFile) (*config, error) {
@@ -76,47 +117,278 @@ func parseConfig(conf *goconf.ConfigFile) (*config, error) {
 		username: user,
 		password: password,
 		dbName:   dbname,
+		tlsMode:  "off",
+	}
+
+	// Everything below is optional: a config file that omits it keeps the
+	// plaintext, default-timeout behavior Cherry has always had.
+	if mode, err := conf.GetString("database", "tls"); err == nil && len(mode) > 0 {
+		switch mode {
+		case "off", "skip-verify", "preferred", "required":
+			v.tlsMode = mode
+		default:
+			return nil, fmt.Errorf("invalid database tls mode in the config file: %v", mode)
+		}
+	}
+	v.tlsCAFile, _ = conf.GetString("database", "tls_ca")
+	v.tlsCertFile, _ = conf.GetString("database", "tls_cert")
+	v.tlsKeyFile, _ = conf.GetString("database", "tls_key")
+	v.tlsServerName, _ = conf.GetString("database", "tls_server_name")
+
+	if parseTime, err := conf.GetBool("database", "parse_time"); err == nil {
+		v.parseTime = parseTime
 	}
+	if timeout, err := conf.GetInt("database", "read_timeout"); err == nil && timeout > 0 {
+		v.readTimeout = time.Duration(timeout) * time.Second
+	}
+	if timeout, err := conf.GetInt("database", "write_timeout"); err == nil && timeout > 0 {
+		v.writeTimeout = time.Duration(timeout) * time.Second
+	}
+	v.collation, _ = conf.GetString("database", "collation")
+	if lifetime, err := conf.GetInt("database", "conn_max_lifetime"); err == nil && lifetime > 0 {
+		v.connMaxLifetime = time.Duration(lifetime) * time.Second
+	}
+
 	return v, nil
 }
 
+// applyTLS configures dsn's TLS settings for c.tlsMode. It leaves dsn
+// untouched when TLS is disabled.
+//
+// go-sql-driver/mysql only grants its built-in "use TLS if the server
+// offers it, otherwise fall back to plaintext" behavior when TLSConfig is
+// literally the string "preferred"; setting a *tls.Config via dsn.TLS
+// directly is otherwise treated as a hard TLS requirement unless
+// AllowFallbackToPlaintext is also set. So plain tls=preferred (no custom
+// CA/cert/server name) is passed through as the literal string, and every
+// other combination — including tls=preferred with a custom CA, which
+// needs both a *tls.Config and fallback — builds a *tls.Config and sets
+// dsn.TLS and dsn.AllowFallbackToPlaintext directly. Note this means dsn
+// must reach sql.DB via mysql.NewConnector, not dsn.FormatDSN(): FormatDSN
+// only ever serializes dsn.TLSConfig, never a dsn.TLS set this way.
+func applyTLS(dsn *mysql.Config, c *config) error {
+	if c.tlsMode == "" || c.tlsMode == "off" {
+		return nil
+	}
+	if c.tlsMode == "preferred" && len(c.tlsCAFile) == 0 && len(c.tlsCertFile) == 0 && len(c.tlsKeyFile) == 0 && len(c.tlsServerName) == 0 {
+		dsn.TLSConfig = "preferred"
+		return nil
+	}
+
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: c.tlsMode == "skip-verify" || c.tlsMode == "preferred",
+		ServerName:         c.tlsServerName,
+	}
+
+	if len(c.tlsCAFile) > 0 {
+		pem, err := ioutil.ReadFile(c.tlsCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read database tls_ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("failed to parse database tls_ca: %v", c.tlsCAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if len(c.tlsCertFile) > 0 || len(c.tlsKeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(c.tlsCertFile, c.tlsKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load database tls client cert/key: %v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	dsn.TLS = tlsCfg
+	if c.tlsMode == "preferred" {
+		dsn.AllowFallbackToPlaintext = true
+	}
+
+	return nil
+}
+
 func NewMySQL(conf *goconf.ConfigFile) (*MySQL, error) {
 	c, err := parseConfig(conf)
 	if err != nil {
 		return nil, err
 	}
 
-	db := make([]*sql.DB, 0)
+	hostDB := make(map[string]*sql.DB)
+	var hosts []string
 	var lastErr error
 	for _, host := range c.hosts {
-		v, err := newDBConn(host, c.username, c.password, c.dbName, c.port)
+		v, err := newDBConn(host, c)
 		if err != nil {
 			lastErr = err
 			continue
 		}
 		v.SetMaxOpenConns(32)
 		v.SetMaxIdleConns(4)
+		// Backends behind a load balancer may silently recycle idle
+		// connections; recycling ours periodically avoids handing
+		// queries to a socket the load balancer already killed.
+		v.SetConnMaxLifetime(c.connMaxLifetime)
 		if err := createTables(v); err != nil {
 			lastErr = err
 			continue
 		}
-		db = append(db, v)
+		hostDB[host] = v
+		hosts = append(hosts, host)
 	}
-	if len(db) == 0 {
+	if len(hostDB) == 0 {
 		return nil, fmt.Errorf("no avaliable database server: %v", lastErr)
 	}
+
 	mysql := &MySQL{
-		db: db,
+		hostDB: hostDB,
+		health: newHealthTracker(hosts, func(host string) error {
+			return hostDB[host].Ping()
+		}),
+		macCache:      newTTLLRU(lookupCacheTTL, lookupCacheCapacity),
+		locationCache: newTTLLRU(lookupCacheTTL, lookupCacheCapacity),
 	}
 
 	return mysql, nil
 }
 
-func newDBConn(host, username, password, dbname string, port uint16) (*sql.DB, error) {
-	db, err := sql.Open("mysql", fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?timeout=5s", username, password, host, port, dbname))
+func createTables(db *sql.DB) error {
+	return migrate(db, mysqlSchema)
+}
+
+// Close closes all the underlying connection pools and stops the
+// background health-checker.
+func (r *MySQL) Close() error {
+	r.health.close()
+
+	r.stmts.Range(func(k, v interface{}) bool {
+		v.(*sql.Stmt).Close()
+		r.stmts.Delete(k)
+		return true
+	})
+
+	var lastErr error
+	for _, db := range r.hostDB {
+		if err := db.Close(); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// Stats returns the current per-host failover health alongside the
+// read-through cache's hit/miss counters.
+func (r *MySQL) Stats() Stats {
+	macHits, macMisses := r.macCache.stats()
+	locHits, locMisses := r.locationCache.stats()
+
+	return Stats{
+		Hosts: r.health.stats(),
+		Cache: CacheStats{
+			MACHits:        macHits,
+			MACMisses:      macMisses,
+			LocationHits:   locHits,
+			LocationMisses: locMisses,
+		},
+	}
+}
+
+// InvalidateIP evicts any cached MAC() answer for ip. Topology discovery
+// should call this as soon as it learns ip moved to a different host.
+func (r *MySQL) InvalidateIP(ip net.IP) {
+	r.macCache.invalidate(ip.String())
+}
+
+// InvalidateMAC evicts any cached Location() answer for mac. Topology
+// discovery should call this as soon as it learns mac moved to a different
+// switch port.
+func (r *MySQL) InvalidateMAC(mac net.HardwareAddr) {
+	r.locationCache.invalidate(mac.String())
+}
+
+// stmt returns the cached prepared statement for qry on host, preparing
+// and caching it on first use.
+func (r *MySQL) stmt(ctx context.Context, host string, db *sql.DB, qry string) (*sql.Stmt, error) {
+	key := host + "\x00" + qry
+	if v, ok := r.stmts.Load(key); ok {
+		return v.(*sql.Stmt), nil
+	}
+
+	stmt, err := db.PrepareContext(ctx, qry)
+	if err != nil {
+		return nil, err
+	}
+	r.stmts.Store(key, stmt)
+
+	return stmt, nil
+}
+
+// evictStmts closes and forgets every prepared statement cached for host,
+// so the next query re-prepares against the (possibly reconnected) pool.
+func (r *MySQL) evictStmts(host string) {
+	prefix := host + "\x00"
+	r.stmts.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			v.(*sql.Stmt).Close()
+			r.stmts.Delete(k)
+		}
+		return true
+	})
+}
+
+// buildDSN translates host and c into the mysql.Config newDBConn opens a
+// connection with. host is either a bare hostname (combined with c.port
+// over TCP) or a "unix(/path/to/socket)" address for a local MySQL socket.
+// Split out from newDBConn so the DSN-building logic can be unit tested
+// without a live server.
+func buildDSN(host string, c *config) (mysql.Config, error) {
+	dsn := mysql.Config{
+		User:      c.username,
+		Passwd:    c.password,
+		DBName:    c.dbName,
+		Timeout:   5 * time.Second,
+		ParseTime: c.parseTime,
+		Collation: c.collation,
+	}
+	if err := applyTLS(&dsn, c); err != nil {
+		return mysql.Config{}, err
+	}
+	if strings.HasPrefix(host, "unix(") && strings.HasSuffix(host, ")") {
+		dsn.Net = "unix"
+		dsn.Addr = strings.TrimSuffix(strings.TrimPrefix(host, "unix("), ")")
+	} else {
+		dsn.Net = "tcp"
+		dsn.Addr = fmt.Sprintf("%v:%v", host, c.port)
+	}
+	if c.readTimeout > 0 {
+		dsn.ReadTimeout = c.readTimeout
+	}
+	if c.writeTimeout > 0 {
+		dsn.WriteTimeout = c.writeTimeout
+	}
+
+	return dsn, nil
+}
+
+// newDBConn opens a connection pool to host, which is either a bare
+// hostname (combined with c.port over TCP) or a "unix(/path/to/socket)"
+// address for a local MySQL socket.
+//
+// This goes through mysql.NewConnector rather than sql.Open(dsn.FormatDSN())
+// because a custom TLS mode sets dsn.TLS directly (see applyTLS), and
+// FormatDSN has no way to serialize a *tls.Config into a DSN string.
+func newDBConn(host string, c *config) (*sql.DB, error) {
+	dsn, err := buildDSN(host, c)
 	if err != nil {
 		return nil, err
 	}
+
+	connector, err := mysql.NewConnector(&dsn)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
@@ -134,6 +406,13 @@ func isDeadlock(err error) bool {
 }
 
 func isConnectionError(err error) bool {
+	// A canceled or timed-out request is not a server-side connection
+	// failure: don't treat it like one or we would burn through every
+	// failover host chasing a request nobody is waiting for anymore.
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+
 	e, ok := err.(*mysql.MySQLError)
 	// Assume all errors except MySQLError are connection failure
 	if !ok || e.Number >= 2000 {
@@ -143,21 +422,43 @@ func isConnectionError(err error) bool {
 	return false
 }
 
-func (r *MySQL) query(f func(*sql.DB) error) error {
+func (r *MySQL) query(ctx context.Context, f func(context.Context, string, *sql.DB) error) error {
 	var err error
 
-	for _, db := range r.db {
+	// health.order() puts the healthiest host first, so a host that's
+	// known to be down doesn't cost this call a failed round-trip.
+	for _, host := range r.health.order() {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		db := r.hostDB[host]
+
 		deadlockRetry := 0
 
 	retry:
-		err = f(db)
+		start := time.Now()
+		err = f(ctx, host, db)
+		latency := time.Since(start)
+
 		if err == nil {
+			r.health.record(host, nil, latency)
 			return nil
 		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// The caller gave up; don't burn the remaining failover
+			// hosts on a request nobody wants anymore.
+			return ctxErr
+		}
 		if isConnectionError(err) {
-			// Use other DB server if we got connection failure
+			// Use other DB server if we got connection failure, and
+			// re-prepare its statements next time it's tried.
+			r.health.record(host, err, latency)
+			r.evictStmts(host)
 			continue
 		}
+		// The connection itself is fine; whatever went wrong (e.g. a
+		// deadlock) is not this host's fault.
+		r.health.record(host, nil, latency)
 
 		if !isDeadlock(err) || deadlockRetry >= maxDeadlockRetry {
 			return err
@@ -169,18 +470,27 @@ func (r *MySQL) query(f func(*sql.DB) error) error {
 	return err
 }
 
-func (r *MySQL) MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
+func (r *MySQL) MAC(ctx context.Context, ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
 	if ip == nil {
 		panic("IP address is nil")
 	}
 
-	f := func(db *sql.DB) error {
-		qry := `SELECT mac 
-			FROM host A 
-			JOIN ip B 
-			ON A.ip_id = B.id 
+	cacheKey := ip.String()
+	if v, hit := r.macCache.get(cacheKey); hit {
+		return v.(net.HardwareAddr), true, nil
+	}
+
+	f := func(ctx context.Context, host string, db *sql.DB) error {
+		qry := `SELECT mac
+			FROM host A
+			JOIN ip B
+			ON A.ip_id = B.id
 			WHERE B.address = INET_ATON(?)`
-		row, err := db.Query(qry, ip.String())
+		stmt, err := r.stmt(ctx, host, db, qry)
+		if err != nil {
+			return err
+		}
+		row, err := stmt.QueryContext(ctx, cacheKey)
 		if err != nil {
 			return err
 		}
@@ -206,26 +516,39 @@ func (r *MySQL) MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
 
 		return nil
 	}
-	err = r.query(f)
+	err = r.query(ctx, f)
+	if err == nil && ok {
+		r.macCache.set(cacheKey, mac)
+	}
 
 	return mac, ok, err
 }
 
-func (r *MySQL) Location(mac net.HardwareAddr) (dpid string, port uint32, ok bool, err error) {
+func (r *MySQL) Location(ctx context.Context, mac net.HardwareAddr) (dpid string, port uint32, ok bool, err error) {
 	if mac == nil {
 		panic("MAC address is nil")
 	}
 
-	f := func(db *sql.DB) error {
-		qry := `SELECT A.dpid, B.number 
-			FROM switch A 
-			JOIN port B 
-			ON B.switch_id = A.id 
-			JOIN host C 
-			ON C.port_id = B.id 
+	cacheKey := mac.String()
+	if v, hit := r.locationCache.get(cacheKey); hit {
+		loc := v.(mysqlLocation)
+		return loc.dpid, loc.port, true, nil
+	}
+
+	f := func(ctx context.Context, host string, db *sql.DB) error {
+		qry := `SELECT A.dpid, B.number
+			FROM switch A
+			JOIN port B
+			ON B.switch_id = A.id
+			JOIN host C
+			ON C.port_id = B.id
 			WHERE C.mac = ?
 			GROUP BY(A.dpid)`
-		row, err := db.Query(qry, []byte(mac))
+		stmt, err := r.stmt(ctx, host, db, qry)
+		if err != nil {
+			return err
+		}
+		row, err := stmt.QueryContext(ctx, []byte(mac))
 		if err != nil {
 			return err
 		}
@@ -246,7 +569,10 @@ func (r *MySQL) Location(mac net.HardwareAddr) (dpid string, port uint32, ok boo
 
 		return nil
 	}
-	err = r.query(f)
+	err = r.query(ctx, f)
+	if err == nil && ok {
+		r.locationCache.set(cacheKey, mysqlLocation{dpid: dpid, port: port})
+	}
 
 	return dpid, port, ok, err
 }
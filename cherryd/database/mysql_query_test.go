@@ -0,0 +1,106 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// newTestMySQL builds a MySQL backend around hosts without ever dialing a
+// real server, so query()'s context-cancellation handling can be tested in
+// isolation. Each host maps to a nil *sql.DB; the callback passed to
+// query() must not dereference it.
+func newTestMySQL(hosts []string) *MySQL {
+	hostDB := make(map[string]*sql.DB)
+	for _, host := range hosts {
+		hostDB[host] = nil
+	}
+
+	return &MySQL{
+		hostDB: hostDB,
+		health: newHealthTracker(hosts, func(string) error { return nil }),
+	}
+}
+
+func TestQueryReturnsImmediatelyOnCanceledContext(t *testing.T) {
+	r := newTestMySQL([]string{"a", "b", "c"})
+	defer r.health.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	visited := 0
+	err := r.query(ctx, func(ctx context.Context, host string, db *sql.DB) error {
+		visited++
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("query() error = %v, want context.Canceled", err)
+	}
+	if visited != 0 {
+		t.Fatalf("query() called f %d times on an already-canceled context, want 0", visited)
+	}
+}
+
+func TestQueryStopsFailoverOnceContextExpiresMidCall(t *testing.T) {
+	r := newTestMySQL([]string{"a", "b", "c"})
+	defer r.health.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	visited := 0
+	err := r.query(ctx, func(ctx context.Context, host string, db *sql.DB) error {
+		visited++
+		// The context is canceled while this host's query is "in flight".
+		cancel()
+		return errors.New("connection refused")
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("query() error = %v, want context.Canceled", err)
+	}
+	if visited != 1 {
+		t.Fatalf("query() visited %d hosts after the context expired mid-call, want 1 (no further failover)", visited)
+	}
+}
+
+func TestQuerySucceedsWithoutCancellation(t *testing.T) {
+	r := newTestMySQL([]string{"a", "b"})
+	defer r.health.close()
+
+	visited := 0
+	err := r.query(context.Background(), func(ctx context.Context, host string, db *sql.DB) error {
+		visited++
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("query() returned error: %v", err)
+	}
+	if visited != 1 {
+		t.Fatalf("query() visited %d hosts, want 1", visited)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dlintw/goconf"
+)
+
+func baseConfigFile() *goconf.ConfigFile {
+	c := goconf.NewConfigFile()
+	c.AddOption("database", "host", "db1, db2")
+	c.AddOption("database", "port", "3306")
+	c.AddOption("database", "user", "cherry")
+	c.AddOption("database", "password", "secret")
+	c.AddOption("database", "name", "cherry")
+
+	return c
+}
+
+func TestParseConfigRequiredFields(t *testing.T) {
+	c, err := parseConfig(baseConfigFile())
+	if err != nil {
+		t.Fatalf("parseConfig() returned error: %v", err)
+	}
+
+	if len(c.hosts) != 2 || c.hosts[0] != "db1" || c.hosts[1] != "db2" {
+		t.Fatalf("hosts = %v, want [db1 db2]", c.hosts)
+	}
+	if c.port != 3306 || c.username != "cherry" || c.password != "secret" || c.dbName != "cherry" {
+		t.Fatalf("unexpected parsed config: %+v", c)
+	}
+	if c.tlsMode != "off" {
+		t.Fatalf("tlsMode = %q, want the default of off", c.tlsMode)
+	}
+}
+
+func TestParseConfigMissingRequiredField(t *testing.T) {
+	for _, option := range []string{"host", "port", "user", "password", "name"} {
+		cf := baseConfigFile()
+		cf.RemoveOption("database", option)
+
+		if _, err := parseConfig(cf); err == nil {
+			t.Fatalf("parseConfig() should fail when %q is missing", option)
+		}
+	}
+}
+
+func TestParseConfigInvalidTLSMode(t *testing.T) {
+	cf := baseConfigFile()
+	cf.AddOption("database", "tls", "bogus")
+
+	if _, err := parseConfig(cf); err == nil {
+		t.Fatal("parseConfig() should reject an unknown tls mode")
+	}
+}
+
+func TestParseConfigOptionalFields(t *testing.T) {
+	cf := baseConfigFile()
+	cf.AddOption("database", "tls", "required")
+	cf.AddOption("database", "parse_time", "true")
+	cf.AddOption("database", "read_timeout", "7")
+	cf.AddOption("database", "write_timeout", "9")
+	cf.AddOption("database", "collation", "utf8mb4_general_ci")
+	cf.AddOption("database", "conn_max_lifetime", "60")
+
+	c, err := parseConfig(cf)
+	if err != nil {
+		t.Fatalf("parseConfig() returned error: %v", err)
+	}
+
+	if c.tlsMode != "required" {
+		t.Fatalf("tlsMode = %q, want required", c.tlsMode)
+	}
+	if !c.parseTime {
+		t.Fatal("parseTime = false, want true")
+	}
+	if c.readTimeout != 7*time.Second || c.writeTimeout != 9*time.Second {
+		t.Fatalf("readTimeout/writeTimeout = %v/%v, want 7s/9s", c.readTimeout, c.writeTimeout)
+	}
+	if c.collation != "utf8mb4_general_ci" {
+		t.Fatalf("collation = %q, want utf8mb4_general_ci", c.collation)
+	}
+	if c.connMaxLifetime != 60*time.Second {
+		t.Fatalf("connMaxLifetime = %v, want 60s", c.connMaxLifetime)
+	}
+}
+
+func TestBuildDSNTLSModes(t *testing.T) {
+	cases := []struct {
+		name                   string
+		tlsMode                string
+		tlsCAFile              string
+		wantTLSConfig          string
+		wantCustomTLS          bool
+		wantAllowFallback      bool
+		wantInsecureSkipVerify bool
+	}{
+		{
+			name:    "off",
+			tlsMode: "off",
+		},
+		{
+			name:                   "skip-verify",
+			tlsMode:                "skip-verify",
+			wantCustomTLS:          true,
+			wantInsecureSkipVerify: true,
+		},
+		{
+			name:          "preferred without custom CA uses the driver's literal string",
+			tlsMode:       "preferred",
+			wantTLSConfig: "preferred",
+		},
+		{
+			name:                   "preferred with a custom CA still falls back to plaintext",
+			tlsMode:                "preferred",
+			tlsCAFile:              testCAFile(t),
+			wantCustomTLS:          true,
+			wantAllowFallback:      true,
+			wantInsecureSkipVerify: true,
+		},
+		{
+			name:          "required",
+			tlsMode:       "required",
+			wantCustomTLS: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config{
+				username:  "cherry",
+				password:  "secret",
+				dbName:    "cherry",
+				port:      3306,
+				tlsMode:   tc.tlsMode,
+				tlsCAFile: tc.tlsCAFile,
+			}
+
+			dsn, err := buildDSN("db1", c)
+			if err != nil {
+				t.Fatalf("buildDSN() returned error: %v", err)
+			}
+
+			if dsn.TLSConfig != tc.wantTLSConfig {
+				t.Fatalf("TLSConfig = %q, want %q", dsn.TLSConfig, tc.wantTLSConfig)
+			}
+			if tc.wantCustomTLS && dsn.TLS == nil {
+				t.Fatal("expected dsn.TLS to be set directly")
+			}
+			if !tc.wantCustomTLS && dsn.TLS != nil {
+				t.Fatal("expected dsn.TLS to be left unset")
+			}
+			if dsn.AllowFallbackToPlaintext != tc.wantAllowFallback {
+				t.Fatalf("AllowFallbackToPlaintext = %v, want %v", dsn.AllowFallbackToPlaintext, tc.wantAllowFallback)
+			}
+			if tc.wantCustomTLS && dsn.TLS.InsecureSkipVerify != tc.wantInsecureSkipVerify {
+				t.Fatalf("InsecureSkipVerify = %v, want %v", dsn.TLS.InsecureSkipVerify, tc.wantInsecureSkipVerify)
+			}
+		})
+	}
+}
+
+// testCAFile generates a throwaway self-signed CA certificate, writes it
+// PEM-encoded to a temp file and returns its path, since buildDSN only
+// exercises the "a CA file was configured" branch once one actually parses.
+func testCAFile(t *testing.T) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"cherry test CA"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create test CA certificate: %v", err)
+	}
+
+	f, err := os.CreateTemp("", "cherry-test-ca-*.pem")
+	if err != nil {
+		t.Fatalf("failed to create temp CA file: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("failed to write temp CA file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close temp CA file: %v", err)
+	}
+
+	return f.Name()
+}
+
+func TestBuildDSNUnixSocket(t *testing.T) {
+	c := &config{username: "cherry", password: "secret", dbName: "cherry", port: 3306, tlsMode: "off"}
+
+	dsn, err := buildDSN("unix(/var/run/mysqld/mysqld.sock)", c)
+	if err != nil {
+		t.Fatalf("buildDSN() returned error: %v", err)
+	}
+	if dsn.Net != "unix" || dsn.Addr != "/var/run/mysqld/mysqld.sock" {
+		t.Fatalf("Net/Addr = %q/%q, want unix//var/run/mysqld/mysqld.sock", dsn.Net, dsn.Addr)
+	}
+}
+
+func TestBuildDSNTCP(t *testing.T) {
+	c := &config{username: "cherry", password: "secret", dbName: "cherry", port: 3306, tlsMode: "off"}
+
+	dsn, err := buildDSN("db1", c)
+	if err != nil {
+		t.Fatalf("buildDSN() returned error: %v", err)
+	}
+	if dsn.Net != "tcp" || dsn.Addr != "db1:3306" {
+		t.Fatalf("Net/Addr = %q/%q, want tcp/db1:3306", dsn.Net, dsn.Addr)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+
+	"github.com/dlintw/goconf"
+	"github.com/lib/pq"
+)
+
+// postgresDeadlockErrCode is the SQLSTATE code Postgres returns when it
+// aborts a transaction to break a deadlock.
+const postgresDeadlockErrCode = "40P01"
+
+// Postgres is a multi-host Backend that fails over across db in config
+// order.
+//
+// Unlike MySQL, it does not yet have a background health-checker: query()
+// always tries hosts in the order they were configured, so a permanently
+// dead first host costs one failed round-trip on every single query
+// instead of being demoted out of rotation. It also has no prepared
+// statement or read-through cache, so every MAC/Location call re-parses
+// its SQL. Operators running driver=postgres in front of a real failover
+// setup should be aware of this gap before relying on it the way they
+// would on the MySQL backend; closing it is a fast-follow, not done here.
+type Postgres struct {
+	db []*sql.DB
+}
+
+func parsePostgresConfig(conf *goconf.ConfigFile) (*config, error) {
+	// The config file layout is shared with the MySQL backend: a comma
+	// separated host list, port, user, password and database name under
+	// the "database" section.
+	return parseConfig(conf)
+}
+
+func NewPostgres(conf *goconf.ConfigFile) (*Postgres, error) {
+	c, err := parsePostgresConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	db := make([]*sql.DB, 0)
+	var lastErr error
+	for _, host := range c.hosts {
+		v, err := newPostgresConn(host, c.username, c.password, c.dbName, c.port)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		v.SetMaxOpenConns(32)
+		v.SetMaxIdleConns(4)
+		v.SetConnMaxLifetime(c.connMaxLifetime)
+		if err := migrate(v, postgresSchema); err != nil {
+			lastErr = err
+			continue
+		}
+		db = append(db, v)
+	}
+	if len(db) == 0 {
+		return nil, fmt.Errorf("no avaliable database server: %v", lastErr)
+	}
+
+	return &Postgres{db: db}, nil
+}
+
+func newPostgresConn(host, username, password, dbname string, port uint16) (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%v port=%v user=%v password=%v dbname=%v sslmode=disable connect_timeout=5", host, port, username, password, dbname)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func isPostgresDeadlock(err error) bool {
+	e, ok := err.(*pq.Error)
+	if !ok {
+		return false
+	}
+
+	return string(e.Code) == postgresDeadlockErrCode
+}
+
+func isPostgresConnectionError(err error) bool {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+
+	_, ok := err.(*pq.Error)
+	// Assume all errors except pq.Error are connection failure.
+	return !ok
+}
+
+func (r *Postgres) query(ctx context.Context, f func(context.Context, *sql.DB) error) error {
+	var err error
+
+	for _, db := range r.db {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		deadlockRetry := 0
+
+	retry:
+		err = f(ctx, db)
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if isPostgresConnectionError(err) {
+			// Use other DB server if we got connection failure.
+			continue
+		}
+
+		if !isPostgresDeadlock(err) || deadlockRetry >= maxDeadlockRetry {
+			return err
+		}
+		deadlockRetry++
+		goto retry
+	}
+
+	return err
+}
+
+func (r *Postgres) MAC(ctx context.Context, ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
+	if ip == nil {
+		panic("IP address is nil")
+	}
+	// The address column only stores IPv4 addresses, so treat an IPv6
+	// address the same as an unknown IPv4 one instead of panicking.
+	if ip.To4() == nil {
+		return nil, false, nil
+	}
+
+	f := func(ctx context.Context, db *sql.DB) error {
+		qry := `SELECT mac
+			FROM host A
+			JOIN ip B
+			ON A.ip_id = B.id
+			WHERE B.address = $1`
+		row, err := db.QueryContext(ctx, qry, ipToUint32(ip))
+		if err != nil {
+			return err
+		}
+		defer row.Close()
+
+		// Unknown IP address?
+		if !row.Next() {
+			return nil
+		}
+		if err := row.Err(); err != nil {
+			return err
+		}
+
+		var v []byte
+		if err := row.Scan(&v); err != nil {
+			return err
+		}
+		if v == nil || len(v) != 6 {
+			panic("Invalid MAC address")
+		}
+		mac = net.HardwareAddr(v)
+		ok = true
+
+		return nil
+	}
+	err = r.query(ctx, f)
+
+	return mac, ok, err
+}
+
+func (r *Postgres) Location(ctx context.Context, mac net.HardwareAddr) (dpid string, port uint32, ok bool, err error) {
+	if mac == nil {
+		panic("MAC address is nil")
+	}
+
+	f := func(ctx context.Context, db *sql.DB) error {
+		qry := `SELECT A.dpid, B.number
+			FROM switch A
+			JOIN port B
+			ON B.switch_id = A.id
+			JOIN host C
+			ON C.port_id = B.id
+			WHERE C.mac = $1
+			GROUP BY A.dpid`
+		row, err := db.QueryContext(ctx, qry, []byte(mac))
+		if err != nil {
+			return err
+		}
+		defer row.Close()
+
+		// Unknown MAC address?
+		if !row.Next() {
+			return nil
+		}
+		if err := row.Err(); err != nil {
+			return err
+		}
+
+		if err := row.Scan(&dpid, &port); err != nil {
+			return err
+		}
+		ok = true
+
+		return nil
+	}
+	err = r.query(ctx, f)
+
+	return dpid, port, ok, err
+}
+
+// Close closes all the underlying connection pools.
+func (r *Postgres) Close() error {
+	var lastErr error
+	for _, db := range r.db {
+		if err := db.Close(); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// ipToUint32 converts an IPv4 address to the same big-endian integer
+// representation MySQL's INET_ATON produces. Callers are expected to have
+// already rejected non-IPv4 addresses (see Postgres.MAC/SQLite.MAC); it
+// returns 0 for them rather than panic, since 0 never matches a real
+// address row.
+func ipToUint32(ip net.IP) uint32 {
+	v4 := ip.To4()
+	if v4 == nil {
+		return 0
+	}
+
+	return uint32(v4[0])<<24 | uint32(v4[1])<<16 | uint32(v4[2])<<8 | uint32(v4[3])
+}
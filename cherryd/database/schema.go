@@ -0,0 +1,115 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import "database/sql"
+
+// mysqlSchema brings a fresh MySQL database up to the schema Cherry
+// expects: switches and their ports, and the hosts discovered on them.
+var mysqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS switch (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+		dpid BIGINT UNSIGNED NOT NULL,
+		PRIMARY KEY (id),
+		UNIQUE KEY (dpid)
+	) ENGINE=InnoDB`,
+	`CREATE TABLE IF NOT EXISTS port (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+		switch_id BIGINT UNSIGNED NOT NULL,
+		number INT UNSIGNED NOT NULL,
+		PRIMARY KEY (id),
+		FOREIGN KEY (switch_id) REFERENCES switch (id)
+	) ENGINE=InnoDB`,
+	`CREATE TABLE IF NOT EXISTS ip (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+		address INT UNSIGNED NOT NULL,
+		PRIMARY KEY (id),
+		UNIQUE KEY (address)
+	) ENGINE=InnoDB`,
+	`CREATE TABLE IF NOT EXISTS host (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+		mac BINARY(6) NOT NULL,
+		ip_id BIGINT UNSIGNED,
+		port_id BIGINT UNSIGNED,
+		PRIMARY KEY (id),
+		FOREIGN KEY (ip_id) REFERENCES ip (id),
+		FOREIGN KEY (port_id) REFERENCES port (id)
+	) ENGINE=InnoDB`,
+}
+
+// postgresSchema is the PostgreSQL equivalent of mysqlSchema.
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS switch (
+		id BIGSERIAL PRIMARY KEY,
+		dpid BIGINT NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS port (
+		id BIGSERIAL PRIMARY KEY,
+		switch_id BIGINT NOT NULL REFERENCES switch (id),
+		number INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS ip (
+		id BIGSERIAL PRIMARY KEY,
+		address BIGINT NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS host (
+		id BIGSERIAL PRIMARY KEY,
+		mac BYTEA NOT NULL,
+		ip_id BIGINT REFERENCES ip (id),
+		port_id BIGINT REFERENCES port (id)
+	)`,
+}
+
+// sqliteSchema is the SQLite equivalent of mysqlSchema, for single-node
+// deployments that do not want to run a separate database server.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS switch (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		dpid INTEGER NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS port (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		switch_id INTEGER NOT NULL REFERENCES switch (id),
+		number INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS ip (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		address INTEGER NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS host (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		mac BLOB NOT NULL,
+		ip_id INTEGER REFERENCES ip (id),
+		port_id INTEGER REFERENCES port (id)
+	)`,
+}
+
+// migrate runs stmts against db in order, stopping at the first error.
+func migrate(db *sql.DB, stmts []string) error {
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
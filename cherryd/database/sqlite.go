@@ -0,0 +1,153 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/dlintw/goconf"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite is a single-node Backend backed by a local SQLite file. It has no
+// notion of failover since there is only ever one file to talk to, which
+// makes it a good fit for small, single-controller deployments that don't
+// want to run a separate database server.
+type SQLite struct {
+	db *sql.DB
+}
+
+func parseSQLiteConfig(conf *goconf.ConfigFile) (path string, err error) {
+	path, err = conf.GetString("database", "path")
+	if err != nil || len(path) == 0 {
+		return "", errors.New("empty database path in the config file")
+	}
+
+	return path, nil
+}
+
+func NewSQLite(conf *goconf.ConfigFile) (*SQLite, error) {
+	path, err := parseSQLiteConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%v?_busy_timeout=5000&_foreign_keys=on", path))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer at a time, so there is no point
+	// in pooling more than one connection.
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db, sqliteSchema); err != nil {
+		return nil, err
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+func (r *SQLite) MAC(ctx context.Context, ip net.IP) (mac net.HardwareAddr, ok bool, err error) {
+	if ip == nil {
+		panic("IP address is nil")
+	}
+	// The address column only stores IPv4 addresses, so treat an IPv6
+	// address the same as an unknown IPv4 one instead of panicking.
+	if ip.To4() == nil {
+		return nil, false, nil
+	}
+
+	qry := `SELECT mac
+		FROM host A
+		JOIN ip B
+		ON A.ip_id = B.id
+		WHERE B.address = ?`
+	row, err := r.db.QueryContext(ctx, qry, ipToUint32(ip))
+	if err != nil {
+		return nil, false, err
+	}
+	defer row.Close()
+
+	// Unknown IP address?
+	if !row.Next() {
+		return nil, false, nil
+	}
+	if err := row.Err(); err != nil {
+		return nil, false, err
+	}
+
+	var v []byte
+	if err := row.Scan(&v); err != nil {
+		return nil, false, err
+	}
+	if v == nil || len(v) != 6 {
+		panic("Invalid MAC address")
+	}
+
+	return net.HardwareAddr(v), true, nil
+}
+
+func (r *SQLite) Location(ctx context.Context, mac net.HardwareAddr) (dpid string, port uint32, ok bool, err error) {
+	if mac == nil {
+		panic("MAC address is nil")
+	}
+
+	qry := `SELECT A.dpid, B.number
+		FROM switch A
+		JOIN port B
+		ON B.switch_id = A.id
+		JOIN host C
+		ON C.port_id = B.id
+		WHERE C.mac = ?
+		GROUP BY A.dpid`
+	row, err := r.db.QueryContext(ctx, qry, []byte(mac))
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer row.Close()
+
+	// Unknown MAC address?
+	if !row.Next() {
+		return "", 0, false, nil
+	}
+	if err := row.Err(); err != nil {
+		return "", 0, false, err
+	}
+
+	if err := row.Scan(&dpid, &port); err != nil {
+		return "", 0, false, err
+	}
+
+	return dpid, port, true, nil
+}
+
+// Close closes the underlying connection pool.
+func (r *SQLite) Close() error {
+	return r.db.Close()
+}